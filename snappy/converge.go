@@ -18,6 +18,7 @@
 package snappy
 
 import (
+	"errors"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,21 +30,26 @@ import (
 )
 
 type snapPkg struct {
-	Name          string          `json:"name"`
-	Origin        string          `json:"origin"`
-	Version       string          `json:"version"`
-	Vendor        string          `json:"vendor"`
-	Description   string          `json:"description"`
-	Icon          string          `json:"icon"`
-	Status        string          `json:"status"`
-	Message       string          `json:"message,omitempty"`
-	IsError       bool            `json:"-"`
-	Progress      float64         `json:"progress,omitempty"`
-	InstalledSize int64           `json:"installed_size,omitempty"`
-	DownloadSize  int64           `json:"download_size,omitempty"`
-	Type          snappy.SnapType `json:"type,omitempty"`
-	UIPort        uint64          `json:"ui_port,omitempty"`
-	UIUri         string          `json:"ui_uri,omitempty"`
+	Name           string          `json:"name"`
+	Origin         string          `json:"origin"`
+	Version        string          `json:"version"`
+	Vendor         string          `json:"vendor"`
+	Description    string          `json:"description"`
+	Icon           string          `json:"icon"`
+	Status         string          `json:"status"`
+	Message        string          `json:"message,omitempty"`
+	IsError        bool            `json:"-"`
+	Progress       float64         `json:"progress,omitempty"`
+	InstalledSize  int64           `json:"installed_size,omitempty"`
+	DownloadSize   int64           `json:"download_size,omitempty"`
+	Type           snappy.SnapType `json:"type,omitempty"`
+	UIPort         uint64          `json:"ui_port,omitempty"`
+	UIUri          string          `json:"ui_uri,omitempty"`
+	Channel        string          `json:"channel,omitempty"`
+	Revision       int             `json:"revision,omitempty"`
+	Services       []serviceInfo   `json:"services,omitempty"`
+	DesktopEntries []desktopEntry  `json:"desktop_entries,omitempty"`
+	DataSize       int64           `json:"data_size,omitempty"`
 }
 
 type response struct {
@@ -51,84 +57,249 @@ type response struct {
 	Message string `json:"message"`
 }
 
+// InstallOptions pins an install or refresh to a specific origin and/or
+// channel instead of taking whatever the store currently serves.
+// Revision isn't supported yet: installPackage/refreshPackage reject a
+// request that sets one rather than silently installing the latest.
+type InstallOptions struct {
+	Origin   string `json:"origin,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+}
+
+// revisioner is implemented by snappy parts that expose the revision
+// they were installed at.
+type revisioner interface {
+	Revision() int
+}
+
+// errRevisionUnsupported is returned when an InstallOptions sets
+// Revision, which snappy.Install/Update have no way to pin yet.
+var errRevisionUnsupported = errors.New("pinning to a specific revision is not supported yet")
+
+// qualifiedName builds the "name.origin/channel" form snappy expects to
+// pin an install or refresh to a specific origin and/or channel.
+func qualifiedName(pkgName string, opts InstallOptions) string {
+	name := pkgName
+	if opts.Origin != "" {
+		name += "." + opts.Origin
+	}
+
+	if opts.Channel == "" {
+		return name
+	}
+
+	return name + "/" + opts.Channel
+}
+
 type listFilter struct {
 	Types         []string `json:"types,omitempty"`
 	InstalledOnly bool     `json:"installed_only"`
 }
 
+// pkgPage is a single page of a (possibly filtered) package listing, fit
+// for lazily loading a large store catalogue.
+type pkgPage struct {
+	Items    []snapPkg `json:"items"`
+	Total    int       `json:"total"`
+	NextPage int       `json:"next_page,omitempty"`
+}
+
 // for easier stubbing during testing
 var activeSnapByName = snappy.ActiveSnapByName
 
+// packagePayload builds the full single-package payload for pkgName,
+// including its (possibly systemctl-querying) service list — unlike the
+// bulk listing in allPackages, there's only one snap's worth of work
+// here.
 func (h *Handler) packagePayload(pkgName string) (snapPkg, error) {
 	snapQ := activeSnapByName(pkgName)
 	if snapQ != nil {
-		return h.snapQueryToPayload(snapQ), nil
+		return h.snapQueryToPayload(snapQ, true), nil
 	}
 
 	mStore := snappy.NewMetaStoreRepository()
 	found, err := mStore.Details(pkgName)
 	if err == nil && len(found) != 0 {
-		return h.snapQueryToPayload(found[0]), nil
+		return h.snapQueryToPayload(found[0], true), nil
 	}
 
 	return snapPkg{}, snappy.ErrPackageNotFound
 }
 
-func (h *Handler) allPackages(installedOnly bool) ([]snapPkg, error) {
+// allPackages returns a page of the merged installed/store package list,
+// filtered by filter.Types and query (matched against the package name),
+// and paginated page/pageSize (both 1-based; pageSize <= 0 means
+// unbounded).
+func (h *Handler) allPackages(filter listFilter, query string, page, pageSize int) (pkgPage, error) {
 	mLocal := snappy.NewMetaLocalRepository()
 
 	installedSnaps, err := mLocal.Installed()
 	if err != nil {
-		return nil, err
+		return pkgPage{}, err
 	}
 
 	installedSnapQs := make([]snapPkg, 0, len(installedSnaps))
 	for i := range installedSnaps {
-		installedSnapQs = append(installedSnapQs, h.snapQueryToPayload(installedSnaps[i]))
+		installedSnapQs = append(installedSnapQs, h.snapQueryToPayload(installedSnaps[i], false))
+	}
+
+	searchTerm := query
+	if searchTerm == "" {
+		searchTerm = "*"
 	}
 
 	mStore := snappy.NewUbuntuStoreSnapRepository()
-	remoteSnaps, err := mStore.Search("*")
+	remoteSnaps, err := mStore.Search(searchTerm)
 	if err != nil {
-		return nil, err
+		return pkgPage{}, err
 	}
 
 	remoteSnapQs := make([]snapPkg, 0, len(remoteSnaps))
 
 	for _, remote := range remoteSnaps {
 		if alias := remote.Alias; alias != nil {
-			remoteSnapQs = append(remoteSnapQs, h.snapQueryToPayload(alias))
-		} else {
-			/*
-				TODO reenable once we can filter by type
-				for _, part := range remote.Parts {
-					remoteSnapQs = append(remoteSnapQs, h.snapQueryToPayload(part))
-				}
-			*/
+			remoteSnapQs = append(remoteSnapQs, h.snapQueryToPayload(alias, false))
+			continue
+		}
+
+		for _, part := range remote.Parts {
+			remoteSnapQs = append(remoteSnapQs, h.snapQueryToPayload(part, false))
 		}
 	}
 
-	return mergeSnaps(installedSnapQs, remoteSnapQs, installedOnly), nil
+	orphanedSnapQs := orphanSnaps(installedSnapQs)
+
+	merged := mergeSnaps(installedSnapQs, remoteSnapQs, orphanedSnapQs, filter.InstalledOnly)
+
+	filtered := make([]snapPkg, 0, len(merged))
+	for _, pkg := range merged {
+		if matchesFilter(pkg, filter, query) {
+			filtered = append(filtered, pkg)
+		}
+	}
+
+	return paginate(filtered, page, pageSize), nil
+}
+
+// typeLabel returns the listFilter.Types spelling for t, mirroring the
+// pkg.Type split from the snappy repo (app/framework/oem/kernel/gadget).
+func typeLabel(t snappy.SnapType) string {
+	switch t {
+	case snappy.SnapTypeApp:
+		return "app"
+	case snappy.SnapTypeFramework:
+		return "framework"
+	case snappy.SnapTypeOem:
+		return "oem"
+	case snappy.SnapTypeKernel:
+		return "kernel"
+	case snappy.SnapTypeGadget:
+		return "gadget"
+	default:
+		return string(t)
+	}
+}
+
+// matchesFilter reports whether pkg should be included given filter's
+// type restriction and a free-text query against the package name.
+func matchesFilter(pkg snapPkg, filter listFilter, query string) bool {
+	if len(filter.Types) != 0 {
+		matched := false
+		for _, t := range filter.Types {
+			if t == typeLabel(pkg.Type) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if query != "" && !strings.Contains(strings.ToLower(pkg.Name), strings.ToLower(query)) {
+		return false
+	}
+
+	return true
 }
 
-func (h *Handler) doInstallPackage(progress *webprogress.WebProgress, pkgName string) {
-	_, err := snappy.Install(pkgName, 0, progress)
+// paginate slices pkgs into the requested page (1-based; pageSize <= 0
+// means unbounded) and reports the total count and, if any, the next
+// page number.
+func paginate(pkgs []snapPkg, page, pageSize int) pkgPage {
+	if pageSize <= 0 {
+		pageSize = len(pkgs)
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	total := len(pkgs)
+
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	result := pkgPage{Items: pkgs[start:end], Total: total}
+	if end < total {
+		result.NextPage = page + 1
+	}
+
+	return result
+}
+
+func (h *Handler) doInstallPackage(progress *webprogress.WebProgress, pkgName string, opts InstallOptions) {
+	_, err := snappy.Install(qualifiedName(pkgName, opts), 0, progress)
+	progress.ErrorChan <- err
+	close(progress.ErrorChan)
+}
+
+func (h *Handler) installPackage(pkgName string, opts InstallOptions) error {
+	if opts.Revision != 0 {
+		return errRevisionUnsupported
+	}
+
+	progress, err := h.installStatus.Add(pkgName)
+	if err != nil {
+		return err
+	}
+
+	go h.doInstallPackage(progress, pkgName, opts)
+
+	return nil
+}
+
+// doRefreshPackage runs a qualified update in the background, the
+// refresh equivalent of doInstallPackage.
+func (h *Handler) doRefreshPackage(progress *webprogress.WebProgress, pkgName string, opts InstallOptions) {
+	_, err := snappy.Update(qualifiedName(pkgName, opts), 0, progress)
 	progress.ErrorChan <- err
 	close(progress.ErrorChan)
 }
 
-func (h *Handler) installPackage(pkgName string) error {
+func (h *Handler) refreshPackage(pkgName string, opts InstallOptions) error {
+	if opts.Revision != 0 {
+		return errRevisionUnsupported
+	}
+
 	progress, err := h.installStatus.Add(pkgName)
 	if err != nil {
 		return err
 	}
 
-	go h.doInstallPackage(progress, pkgName)
+	go h.doRefreshPackage(progress, pkgName, opts)
 
 	return nil
 }
 
-func mergeSnaps(installed, remote []snapPkg, installedOnly bool) []snapPkg {
+func mergeSnaps(installed, remote, orphaned []snapPkg, installedOnly bool) []snapPkg {
 	remoteMap := make(map[string]*snapPkg, len(remote))
 
 	// we start with the installed set
@@ -150,6 +321,14 @@ func mergeSnaps(installed, remote []snapPkg, installedOnly bool) []snapPkg {
 		}
 	}
 
+	// Orphaned snaps are local leftovers, not store results, so they are
+	// shown regardless of installedOnly.
+	for i := range orphaned {
+		if _, ok := allMap[orphaned[i].Name]; !ok {
+			allMap[orphaned[i].Name] = &orphaned[i]
+		}
+	}
+
 	snapPkgs := make([]snapPkg, 0, len(allMap))
 
 	for _, v := range allMap {
@@ -165,7 +344,11 @@ func hasPortInformation(snap snappy.Part) bool {
 	return snap.Type() == snappy.SnapTypeApp || snap.Type() == snappy.SnapTypeFramework
 }
 
-func (h *Handler) snapQueryToPayload(snapQ snappy.Part) snapPkg {
+// snapQueryToPayload builds snapQ's web payload. includeServices gates
+// the Services field, which shells out to systemctl per declared
+// service; callers listing many snaps at once (allPackages) should
+// pass false and leave that querying to the single-package endpoint.
+func (h *Handler) snapQueryToPayload(snapQ snappy.Part, includeServices bool) snapPkg {
 	snap := snapPkg{
 		Name:        snapQ.Name(),
 		Origin:      snapQ.Namespace(),
@@ -173,6 +356,11 @@ func (h *Handler) snapQueryToPayload(snapQ snappy.Part) snapPkg {
 		Vendor:      snapQ.Vendor(),
 		Description: snapQ.Description(),
 		Type:        snapQ.Type(),
+		Channel:     snapQ.Channel(),
+	}
+
+	if r, ok := snapQ.(revisioner); ok {
+		snap.Revision = r.Revision()
 	}
 
 	if hasPortInformation(snapQ) {
@@ -183,6 +371,12 @@ func (h *Handler) snapQueryToPayload(snapQ snappy.Part) snapPkg {
 		}
 	}
 
+	if includeServices {
+		if ctrl, err := newServiceController(snapQ.Name()); err == nil {
+			snap.Services = ctrl.list()
+		}
+	}
+
 	if snapQ.IsInstalled() {
 		iconPath, err := localIconPath(snapQ.Name(), snapQ.Icon())
 		if err != nil {
@@ -192,33 +386,56 @@ func (h *Handler) snapQueryToPayload(snapQ snappy.Part) snapPkg {
 
 		snap.Icon = iconPath
 		snap.InstalledSize = snapQ.InstalledSize()
+		snap.DesktopEntries = localDesktopEntries(snapQ.Name())
 	} else {
 		snap.Icon = snapQ.Icon()
 		snap.DownloadSize = snapQ.DownloadSize()
 	}
 
-	if stat, ok := h.installStatus.Get(snap.Name); ok {
-		snap.Status = stat.Status
-		if stat.Done() {
-			defer h.installStatus.Remove(snap.Name)
-
-			if stat.Error != nil {
-				snap.Message = stat.Error.Error()
-				snap.IsError = true
-			}
+	if h.isSideloaded(snap.Name) {
+		snap.Origin = "sideload"
+	}
 
-		} else {
-			snap.Progress = stat.Progress()
-		}
-	} else if snapQ.IsInstalled() {
+	switch {
+	case applyTrackerStatus(&snap, h.installStatus):
+	case applyTrackerStatus(&snap, h.removeStatus):
+	case snapQ.IsInstalled():
 		snap.Status = webprogress.StatusInstalled
-	} else {
+	default:
 		snap.Status = webprogress.StatusUninstalled
 	}
 
 	return snap
 }
 
+// applyTrackerStatus copies tracker's in-flight status for snap.Name
+// onto snap, reporting whether tracker had an entry for it at all. A
+// terminal (done) entry is removed from tracker once read, so a given
+// install/remove is reflected exactly once before the tracker forgets
+// about it.
+func applyTrackerStatus(snap *snapPkg, tracker *webprogress.StatusTracker) bool {
+	stat, ok := tracker.Get(snap.Name)
+	if !ok {
+		return false
+	}
+
+	status, err := stat.Snapshot()
+	snap.Status = status
+
+	if stat.Done() {
+		if err != nil {
+			snap.Message = err.Error()
+			snap.IsError = true
+		}
+
+		tracker.Remove(snap.Name)
+	} else {
+		snap.Progress = stat.Progress()
+	}
+
+	return true
+}
+
 func uiAccess(services []snappy.Service) (port uint64, uri string) {
 	for i := range services {
 		if services[i].Ports == nil {
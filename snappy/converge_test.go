@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"reflect"
+	"testing"
+
+	"launchpad.net/snappy/snappy"
+)
+
+func TestPaginate(t *testing.T) {
+	pkgs := []snapPkg{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	cases := []struct {
+		name           string
+		page, pageSize int
+		wantNames      []string
+		wantTotal      int
+		wantNextPage   int
+	}{
+		{"unbounded", 0, 0, []string{"a", "b", "c", "d", "e"}, 5, 0},
+		{"first page", 1, 2, []string{"a", "b"}, 5, 2},
+		{"middle page", 2, 2, []string{"c", "d"}, 5, 3},
+		{"last page exact", 3, 2, []string{"e"}, 5, 0},
+		{"page past the end", 10, 2, []string{}, 5, 0},
+		{"negative page clamps to 1", -1, 2, []string{"a", "b"}, 5, 2},
+		{"negative page size is unbounded", 1, -1, []string{"a", "b", "c", "d", "e"}, 5, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := paginate(pkgs, c.page, c.pageSize)
+
+			gotNames := make([]string, len(got.Items))
+			for i, pkg := range got.Items {
+				gotNames[i] = pkg.Name
+			}
+
+			if !reflect.DeepEqual(gotNames, c.wantNames) {
+				t.Errorf("items = %v, want %v", gotNames, c.wantNames)
+			}
+			if got.Total != c.wantTotal {
+				t.Errorf("total = %d, want %d", got.Total, c.wantTotal)
+			}
+			if got.NextPage != c.wantNextPage {
+				t.Errorf("next_page = %d, want %d", got.NextPage, c.wantNextPage)
+			}
+		})
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	pkg := snapPkg{Name: "hello-world", Type: snappy.SnapTypeApp}
+
+	cases := []struct {
+		name   string
+		filter listFilter
+		query  string
+		want   bool
+	}{
+		{"no filter matches anything", listFilter{}, "", true},
+		{"matching type", listFilter{Types: []string{"app"}}, "", true},
+		{"non-matching type", listFilter{Types: []string{"framework"}}, "", false},
+		{"matching query substring", listFilter{}, "hello", true},
+		{"matching query is case-insensitive", listFilter{}, "HELLO", true},
+		{"non-matching query", listFilter{}, "nope", false},
+		{"type matches but query doesn't", listFilter{Types: []string{"app"}}, "nope", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := matchesFilter(pkg, c.filter, c.query); got != c.want {
+				t.Errorf("matchesFilter() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestQualifiedName(t *testing.T) {
+	cases := []struct {
+		name    string
+		pkgName string
+		opts    InstallOptions
+		want    string
+	}{
+		{"bare name", "hello", InstallOptions{}, "hello"},
+		{"channel only", "hello", InstallOptions{Channel: "edge"}, "hello/edge"},
+		{"origin only", "hello", InstallOptions{Origin: "canonical"}, "hello.canonical"},
+		{"origin and channel", "hello", InstallOptions{Origin: "canonical", Channel: "edge"}, "hello.canonical/edge"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := qualifiedName(c.pkgName, c.opts); got != c.want {
+				t.Errorf("qualifiedName() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// desktopEntry is the web-facing view of one meta/gui/*.desktop file
+// shipped by a snap, sanitized the way snapd's addPackageDesktopFiles
+// does before it's safe to show or launch from the browser.
+type desktopEntry struct {
+	Name       string   `json:"name"`
+	Icon       string   `json:"icon,omitempty"`
+	Exec       string   `json:"exec"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// snapMountDir returns the directory pkgName's current revision is
+// mounted at, where its meta/ directory lives.
+func snapMountDir(pkgName string) string {
+	return filepath.Join("/var/lib/snappy", pkgName, "current")
+}
+
+// localDesktopEntries parses every meta/gui/*.desktop file shipped by
+// pkgName's current revision. A file that fails to parse is skipped
+// rather than failing the whole package payload.
+func localDesktopEntries(pkgName string) []desktopEntry {
+	guiDir := filepath.Join(snapMountDir(pkgName), "meta", "gui")
+
+	matches, err := filepath.Glob(filepath.Join(guiDir, "*.desktop"))
+	if err != nil {
+		return nil
+	}
+
+	entries := make([]desktopEntry, 0, len(matches))
+	for _, path := range matches {
+		entry, err := parseDesktopFile(pkgName, path)
+		if err != nil {
+			log.Println("skipping desktop entry", path, err)
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func parseDesktopFile(pkgName, path string) (desktopEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return desktopEntry{}, err
+	}
+	defer f.Close()
+
+	var entry desktopEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if section, ok := desktopSectionHeader(line); ok {
+			// [Desktop Entry] is the primary entry; anything after a
+			// different section header (e.g. [Desktop Action ...]) is
+			// not, so stop before it clobbers what we've already read.
+			if section != "Desktop Entry" {
+				break
+			}
+			continue
+		}
+
+		key, value, ok := splitDesktopLine(line)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Name":
+			entry.Name = value
+		case "Icon":
+			entry.Icon = value
+		case "Exec":
+			entry.Exec = sanitizeExec(pkgName, value)
+		case "Categories":
+			entry.Categories = strings.FieldsFunc(value, func(r rune) bool { return r == ';' })
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return desktopEntry{}, err
+	}
+
+	if entry.Exec == "" {
+		return desktopEntry{}, fmt.Errorf("%s: no Exec= line", path)
+	}
+
+	return entry, nil
+}
+
+// desktopSectionHeader reports whether line is a "[Section Name]"
+// header, returning the name between the brackets.
+func desktopSectionHeader(line string) (section string, ok bool) {
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+
+	return line[1 : len(line)-1], true
+}
+
+// splitDesktopLine returns the key/value of a "Key=Value" line, ignoring
+// blanks and comments. Callers are expected to have already handled
+// [Section] headers via desktopSectionHeader.
+func splitDesktopLine(line string) (key, value string, ok bool) {
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+// unsafeExecFields strips the desktop-file field codes (%f, %u, ...)
+// that only make sense for a launcher passing in files/URLs, which a
+// confined snap binary can't honour.
+var unsafeExecFields = strings.NewReplacer(
+	"%f", "", "%F", "",
+	"%u", "", "%U", "",
+	"%d", "", "%D", "",
+	"%n", "", "%N", "",
+	"%i", "", "%c", "", "%k", "", "%v", "", "%m", "",
+)
+
+// sanitizeExec rewrites a desktop file's Exec= line the way snapd's
+// addPackageDesktopFiles does: drop the field codes a snap can't
+// honour, then prefix the command with the snap-run wrapper so it gets
+// the same confinement as the snap's declared binaries.
+func sanitizeExec(pkgName, execLine string) string {
+	execLine = strings.TrimSpace(unsafeExecFields.Replace(execLine))
+
+	return strings.TrimSpace(fmt.Sprintf("/usr/bin/snappy-run %s %s", pkgName, execLine))
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import "testing"
+
+func TestSplitDesktopLine(t *testing.T) {
+	cases := []struct {
+		line      string
+		wantKey   string
+		wantValue string
+		wantOK    bool
+	}{
+		{"Name=Hello", "Name", "Hello", true},
+		{"Icon = icon.png", "Icon", "icon.png", true},
+		{"", "", "", false},
+		{"# a comment", "", "", false},
+		{"[Desktop Entry]", "", "", false},
+		{"NoEquals", "", "", false},
+	}
+
+	for _, c := range cases {
+		key, value, ok := splitDesktopLine(c.line)
+		if ok != c.wantOK || key != c.wantKey || value != c.wantValue {
+			t.Errorf("splitDesktopLine(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				c.line, key, value, ok, c.wantKey, c.wantValue, c.wantOK)
+		}
+	}
+}
+
+func TestDesktopSectionHeader(t *testing.T) {
+	cases := []struct {
+		line        string
+		wantSection string
+		wantOK      bool
+	}{
+		{"[Desktop Entry]", "Desktop Entry", true},
+		{"[Desktop Action new-window]", "Desktop Action new-window", true},
+		{"Name=Hello", "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		section, ok := desktopSectionHeader(c.line)
+		if ok != c.wantOK || section != c.wantSection {
+			t.Errorf("desktopSectionHeader(%q) = (%q, %v), want (%q, %v)",
+				c.line, section, ok, c.wantSection, c.wantOK)
+		}
+	}
+}
+
+func TestSanitizeExec(t *testing.T) {
+	cases := []struct {
+		name    string
+		pkgName string
+		exec    string
+		want    string
+	}{
+		{"strips field codes", "hello-world", "hello-world.gui %U", "/usr/bin/snappy-run hello-world hello-world.gui"},
+		{"no field codes", "hello-world", "hello-world.gui", "/usr/bin/snappy-run hello-world hello-world.gui"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := sanitizeExec(c.pkgName, c.exec); got != c.want {
+				t.Errorf("sanitizeExec() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
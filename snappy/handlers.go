@@ -0,0 +1,310 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"launchpad.net/snappy/snappy"
+	"launchpad.net/webdm/webprogress"
+)
+
+// Handler serves the webdm REST API and owns the trackers for in-flight
+// install and remove operations.
+type Handler struct {
+	mux           *http.ServeMux
+	installStatus *webprogress.StatusTracker
+	removeStatus  *webprogress.StatusTracker
+
+	sideloadMu sync.Mutex
+	sideloaded map[string]bool
+}
+
+// NewHandler builds a Handler with its routes wired up.
+func NewHandler() *Handler {
+	h := &Handler{
+		mux:           http.NewServeMux(),
+		installStatus: webprogress.NewStatusTracker(),
+		removeStatus:  webprogress.NewStatusTracker(),
+		sideloaded:    make(map[string]bool),
+	}
+
+	h.mux.HandleFunc("/api/v2/packages", h.handlePackages)
+	h.mux.HandleFunc("/api/v2/packages/", h.handlePackage)
+	h.mux.HandleFunc("/api/packages/sideload", h.handleSideload)
+
+	return h
+}
+
+// markSideloaded records that pkgName was installed from a local upload
+// rather than the store, so its payload can report Origin "sideload".
+func (h *Handler) markSideloaded(pkgName string) {
+	h.sideloadMu.Lock()
+	defer h.sideloadMu.Unlock()
+
+	h.sideloaded[pkgName] = true
+}
+
+func (h *Handler) isSideloaded(pkgName string) bool {
+	h.sideloadMu.Lock()
+	defer h.sideloadMu.Unlock()
+
+	return h.sideloaded[pkgName]
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) handlePackages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	filter := listFilter{
+		Types:         q["type"],
+		InstalledOnly: q.Get("installed_only") == "true",
+	}
+
+	// Bad/missing page and page_size just fall back to paginate's
+	// defaults (page 1, unbounded).
+	page, _ := strconv.Atoi(q.Get("page"))
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+
+	pkgs, err := h.allPackages(filter, q.Get("query"), page, pageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, pkgs)
+}
+
+// handlePackage dispatches requests under /api/v2/packages/{name}[/...],
+// including the {name}/progress SSE stream.
+func (h *Handler) handlePackage(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v2/packages/")
+	parts := strings.SplitN(rest, "/", 2)
+
+	pkgName := parts[0]
+	if pkgName == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 {
+		switch {
+		case parts[1] == "progress":
+			h.streamProgress(w, r, pkgName)
+			return
+		case parts[1] == "refresh":
+			h.postRefresh(w, r, pkgName)
+			return
+		case parts[1] == "purge":
+			h.postPurge(w, r, pkgName)
+			return
+		case parts[1] == "services":
+			h.handleServices(w, r, pkgName)
+			return
+		case strings.HasPrefix(parts[1], "services/"):
+			h.handleService(w, r, pkgName, strings.TrimPrefix(parts[1], "services/"))
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getPackage(w, r, pkgName)
+	case http.MethodPost:
+		h.postPackage(w, r, pkgName)
+	case http.MethodDelete:
+		h.deletePackage(w, r, pkgName)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) getPackage(w http.ResponseWriter, r *http.Request, pkgName string) {
+	pkg, err := h.packagePayload(pkgName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, pkg)
+}
+
+func (h *Handler) postPackage(w http.ResponseWriter, r *http.Request, pkgName string) {
+	opts, err := decodeInstallOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.installPackage(pkgName, opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, response{Package: pkgName, Message: "install started"})
+}
+
+func (h *Handler) postRefresh(w http.ResponseWriter, r *http.Request, pkgName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := decodeInstallOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.refreshPackage(pkgName, opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, response{Package: pkgName, Message: "refresh started"})
+}
+
+// postPurge wipes the retained data of a removed package, the other
+// half of the orphan-snap lifecycle surfaced in allPackages.
+func (h *Handler) postPurge(w http.ResponseWriter, r *http.Request, pkgName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := purgeData(pkgName); err != nil {
+		switch err {
+		case errStillInstalled:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errNotOrphaned:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, response{Package: pkgName, Message: "data purged"})
+}
+
+func decodeInstallOptions(r *http.Request) (InstallOptions, error) {
+	var opts InstallOptions
+	if r.ContentLength == 0 {
+		return opts, nil
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&opts)
+
+	return opts, err
+}
+
+func (h *Handler) deletePackage(w http.ResponseWriter, r *http.Request, pkgName string) {
+	if err := h.removePackage(pkgName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, response{Package: pkgName, Message: "remove started"})
+}
+
+// streamProgress upgrades the connection to Server-Sent Events and emits
+// a Frame for each update to pkgName's in-flight install or remove that
+// the client keeps up with (frames are dropped for a slow client),
+// closing the stream once the operation is done.
+func (h *Handler) streamProgress(w http.ResponseWriter, r *http.Request, pkgName string) {
+	ch, cancel, ok := h.installStatus.Subscribe(pkgName)
+	if !ok {
+		ch, cancel, ok = h.removeStatus.Subscribe(pkgName)
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("no operation in progress for %q", pkgName), http.StatusNotFound)
+		return
+	}
+	defer cancel()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for {
+		select {
+		case frame, open := <-ch:
+			if !open {
+				return
+			}
+
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return
+			}
+
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+
+			if frame.Done {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// doRemovePackage runs snappy.Remove in the background and reports its
+// result through progress, mirroring doInstallPackage.
+func (h *Handler) doRemovePackage(progress *webprogress.WebProgress, pkgName string) {
+	err := snappy.Remove(pkgName, progress)
+	progress.ErrorChan <- err
+	close(progress.ErrorChan)
+}
+
+func (h *Handler) removePackage(pkgName string) error {
+	progress, err := h.removeStatus.AddRemove(pkgName)
+	if err != nil {
+		return err
+	}
+
+	go h.doRemovePackage(progress, pkgName)
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
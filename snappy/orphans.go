@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"launchpad.net/webdm/webprogress"
+)
+
+// errStillInstalled is returned by purgeData when asked to wipe the
+// data of a snap that is still installed, rather than an orphan.
+var errStillInstalled = errors.New("package is still installed")
+
+// errNotOrphaned is returned by purgeData when pkgName has no retained
+// manifest, i.e. it was never an orphaned snap in the first place.
+var errNotOrphaned = errors.New("package has no retained data to purge")
+
+// manifestSuffix is the extension snappy gives the file recording a
+// package's installed manifest once it's removed, e.g.
+// hello-world_1.0.manifest.
+const manifestSuffix = ".manifest"
+
+// snappyDataDir is where snappy keeps a package's data once it has been
+// removed, alongside the manifest of its last installed version.
+//
+// var, not const, for easier stubbing during testing.
+var snappyDataDir = "/var/lib/snappy"
+
+// orphanSnaps scans snappyDataDir for packages that still hold retained
+// data but aren't part of installed, i.e. "removed parts": the binaries
+// are gone but /var/lib/snappy/<name>/.../current and its manifest
+// remain. A directory is only reported as an orphan if it actually
+// holds a retained manifest; snappyDataDir can otherwise contain
+// unrelated directories (lockfiles, framework bookkeeping) that aren't
+// safe to offer up for purging.
+func orphanSnaps(installed []snapPkg) []snapPkg {
+	known := make(map[string]bool, len(installed))
+	for _, pkg := range installed {
+		known[pkg.Name] = true
+	}
+
+	entries, err := ioutil.ReadDir(snappyDataDir)
+	if err != nil {
+		return nil
+	}
+
+	orphans := make([]snapPkg, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || known[entry.Name()] {
+			continue
+		}
+
+		if !hasRetainedManifest(entry.Name()) {
+			continue
+		}
+
+		size, ok := retainedDataSize(entry.Name())
+		if !ok {
+			continue
+		}
+
+		orphans = append(orphans, snapPkg{
+			Name:     entry.Name(),
+			Status:   webprogress.StatusRemoved,
+			DataSize: size,
+		})
+	}
+
+	return orphans
+}
+
+// hasRetainedManifest reports whether pkgName's data directory holds a
+// manifest file, which is what distinguishes a genuinely orphaned snap
+// from any other directory that happens to live under snappyDataDir.
+func hasRetainedManifest(pkgName string) bool {
+	found := false
+
+	filepath.Walk(filepath.Join(snappyDataDir, pkgName), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || found {
+			return nil
+		}
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), manifestSuffix) {
+			found = true
+		}
+		return nil
+	})
+
+	return found
+}
+
+// retainedDataSize reports the total size of pkgName's retained data
+// directory, and whether it has one at all (a name that was never
+// installed, or one that has already been purged, has none).
+func retainedDataSize(pkgName string) (int64, bool) {
+	dataDir := filepath.Join(snappyDataDir, pkgName)
+
+	info, err := os.Stat(dataDir)
+	if err != nil || !info.IsDir() {
+		return 0, false
+	}
+
+	var size int64
+	err = filepath.Walk(dataDir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false
+	}
+
+	return size, true
+}
+
+// purgeData permanently removes pkgName's retained data directory. It
+// refuses to do so while pkgName is still installed, since that
+// directory is also where the live snap keeps its current data, and it
+// refuses to do so for a name that was never an orphaned snap, since
+// snappyDataDir can hold other, unrelated directories.
+func purgeData(pkgName string) error {
+	if activeSnapByName(pkgName) != nil {
+		return errStillInstalled
+	}
+
+	if !hasRetainedManifest(pkgName) {
+		return errNotOrphaned
+	}
+
+	return os.RemoveAll(filepath.Join(snappyDataDir, pkgName))
+}
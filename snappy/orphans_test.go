@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetainedDataSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webdm-orphans-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origDataDir := snappyDataDir
+	snappyDataDir = dir
+	defer func() { snappyDataDir = origDataDir }()
+
+	pkgDir := filepath.Join(dir, "hello-world", "current")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, "data.bin"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, ok := retainedDataSize("hello-world")
+	if !ok {
+		t.Fatal("retainedDataSize() reported no data, want some")
+	}
+	if size != 10 {
+		t.Errorf("size = %d, want 10", size)
+	}
+
+	if _, ok := retainedDataSize("does-not-exist"); ok {
+		t.Error("retainedDataSize() for a missing package reported data, want none")
+	}
+}
+
+func TestHasRetainedManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webdm-orphans-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origDataDir := snappyDataDir
+	snappyDataDir = dir
+	defer func() { snappyDataDir = origDataDir }()
+
+	withManifest := filepath.Join(dir, "hello-world", "current")
+	if err := os.MkdirAll(withManifest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(withManifest, "hello-world_1.0.manifest"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	withoutManifest := filepath.Join(dir, "some-lockdir")
+	if err := os.MkdirAll(withoutManifest, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasRetainedManifest("hello-world") {
+		t.Error("hasRetainedManifest() = false for a package with a manifest, want true")
+	}
+	if hasRetainedManifest("some-lockdir") {
+		t.Error("hasRetainedManifest() = true for a directory with no manifest, want false")
+	}
+	if hasRetainedManifest("does-not-exist") {
+		t.Error("hasRetainedManifest() = true for a missing directory, want false")
+	}
+}
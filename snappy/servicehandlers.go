@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+)
+
+// handleServices lists pkgName's declared services.
+func (h *Handler) handleServices(w http.ResponseWriter, r *http.Request, pkgName string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctrl, err := newServiceController(pkgName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, ctrl.list())
+}
+
+// handleService dispatches requests under
+// .../packages/{name}/services/{svc}/{start|stop|restart|logs}.
+func (h *Handler) handleService(w http.ResponseWriter, r *http.Request, pkgName, rest string) {
+	svcName, action := splitServicePath(rest)
+	if svcName == "" || action == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctrl, err := newServiceController(pkgName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "start", "stop", "restart":
+		h.postServiceAction(w, r, ctrl, svcName, action)
+	case "logs":
+		h.streamServiceLogs(w, r, ctrl, svcName)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func splitServicePath(rest string) (svcName, action string) {
+	for i := len(rest) - 1; i >= 0; i-- {
+		if rest[i] == '/' {
+			return rest[:i], rest[i+1:]
+		}
+	}
+
+	return "", ""
+}
+
+func (h *Handler) postServiceAction(w http.ResponseWriter, r *http.Request, ctrl *serviceController, svcName, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := ctrl.control(svcName, action); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, response{Package: svcName, Message: action + " requested"})
+}
+
+// streamServiceLogs tails svcName's journal, streaming new lines to the
+// client as they are written until the request is cancelled.
+func (h *Handler) streamServiceLogs(w http.ResponseWriter, r *http.Request, ctrl *serviceController, svcName string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !ctrl.exists(svcName) {
+		http.Error(w, fmt.Sprintf("%q declares no service %q", ctrl.pkgName, svcName), http.StatusNotFound)
+		return
+	}
+
+	tail, err := strconv.Atoi(r.URL.Query().Get("tail"))
+	if err != nil || tail <= 0 {
+		tail = 100
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	cmd := exec.CommandContext(r.Context(), "journalctl", "-u", ctrl.unitName(svcName), "-n", strconv.Itoa(tail), "-f")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := cmd.Start(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cmd.Wait()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		fmt.Fprintln(w, scanner.Text())
+		flusher.Flush()
+	}
+}
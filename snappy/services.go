@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"os/exec"
+
+	"launchpad.net/snappy/snappy"
+)
+
+// serviceInfo is the web-facing view of one service declared by a snap:
+// its exposed ports, and whether systemd currently has it running and
+// enabled.
+type serviceInfo struct {
+	Name    string            `json:"name"`
+	Ports   map[string]string `json:"ports,omitempty"`
+	Running bool              `json:"running"`
+	Enabled bool              `json:"enabled"`
+}
+
+// serviceController wraps the snappy.Services() interface for a single
+// installed snap, translating its declared services into serviceInfo
+// and acting on start/stop/restart/logs requests via the services'
+// underlying systemd units.
+type serviceController struct {
+	pkgName string
+	version string
+	snap    snappy.Services
+}
+
+// newServiceController looks up pkgName and returns a controller for
+// its declared services, or an error if the snap isn't installed or
+// doesn't declare any.
+func newServiceController(pkgName string) (*serviceController, error) {
+	snapQ := activeSnapByName(pkgName)
+	if snapQ == nil {
+		return nil, snappy.ErrPackageNotFound
+	}
+
+	svc, ok := snapQ.(snappy.Services)
+	if !ok {
+		return nil, fmt.Errorf("%q does not declare any services", pkgName)
+	}
+
+	if len(svc.Services()) == 0 {
+		return nil, fmt.Errorf("%q does not declare any services", pkgName)
+	}
+
+	return &serviceController{pkgName: pkgName, version: snapQ.Version(), snap: svc}, nil
+}
+
+// unitName returns the systemd unit backing svcName, following the
+// naming snappy itself uses for generated service units.
+func (c *serviceController) unitName(svcName string) string {
+	return fmt.Sprintf("%s_%s_%s.service", c.pkgName, svcName, c.version)
+}
+
+func (c *serviceController) list() []serviceInfo {
+	declared := c.snap.Services()
+	infos := make([]serviceInfo, 0, len(declared))
+
+	for i := range declared {
+		infos = append(infos, c.describe(declared[i]))
+	}
+
+	return infos
+}
+
+func (c *serviceController) describe(svc snappy.Service) serviceInfo {
+	info := serviceInfo{Name: svc.Name}
+
+	if svc.Ports != nil {
+		info.Ports = make(map[string]string, len(svc.Ports.External))
+		for name, port := range svc.Ports.External {
+			info.Ports[name] = port.Port
+		}
+	}
+
+	info.Running = c.isActive(svc.Name)
+	info.Enabled = c.isEnabled(svc.Name)
+
+	return info
+}
+
+func (c *serviceController) isActive(svcName string) bool {
+	return exec.Command("systemctl", "is-active", "--quiet", c.unitName(svcName)).Run() == nil
+}
+
+func (c *serviceController) isEnabled(svcName string) bool {
+	return exec.Command("systemctl", "is-enabled", "--quiet", c.unitName(svcName)).Run() == nil
+}
+
+// exists reports whether svcName is one of the services pkgName
+// actually declares, so control/logs requests can't be pointed at an
+// arbitrary unit name.
+func (c *serviceController) exists(svcName string) bool {
+	for _, svc := range c.snap.Services() {
+		if svc.Name == svcName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// control runs action (start/stop/restart) against svcName's unit.
+func (c *serviceController) control(svcName, action string) error {
+	if !c.exists(svcName) {
+		return fmt.Errorf("%q declares no service %q", c.pkgName, svcName)
+	}
+
+	return exec.Command("systemctl", action, c.unitName(svcName)).Run()
+}
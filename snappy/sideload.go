@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"launchpad.net/snappy/snappy"
+	"launchpad.net/webdm/webprogress"
+)
+
+// maxSideloadFormMemory bounds how much of the multipart form, the
+// uploaded .snap included, webdm buffers in memory; ParseMultipartForm
+// spools whatever exceeds it to temp files.
+const maxSideloadFormMemory = 32 << 20
+
+// handleSideload accepts a multipart upload of a local .snap (squashfs
+// or clickdeb) file and installs it via snappy.InstallLocal, bypassing
+// the store entirely.
+func (h *Handler) handleSideload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxSideloadFormMemory); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("snap")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	devmode := r.FormValue("allow_unauthenticated") == "true" || r.FormValue("devmode") == "true"
+
+	path, err := writeSideloadFile(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// uploadName is only a placeholder key to track progress under until
+	// snappy.InstallLocal reports the snap's real name.
+	uploadName := header.Filename
+
+	if err := h.sideloadPackage(uploadName, path, devmode); err != nil {
+		os.Remove(path)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, response{Package: uploadName, Message: "sideload started"})
+}
+
+// writeSideloadFile copies src to a fresh temp file and returns its
+// path; the caller is responsible for removing it once installed.
+func writeSideloadFile(src io.Reader) (string, error) {
+	dst, err := ioutil.TempFile("", "webdm-sideload-*.snap")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+
+	return dst.Name(), nil
+}
+
+// doSideloadPackage installs the snap already written to path, the
+// sideload equivalent of doInstallPackage. Progress starts out tracked
+// under uploadName, but snappy.InstallLocal's real installed name is
+// what callers will actually query by, so the tracker entry (and the
+// sideload marker) move to it as soon as it's known. Neither is marked
+// sideloaded on a failed install: InstallLocal reports no real name
+// then, and marking the raw uploadName would leak an entry that never
+// gets cleared, and could later misattribute a store-installed package
+// of the same name as sideloaded.
+func (h *Handler) doSideloadPackage(progress *webprogress.WebProgress, uploadName, path string, devmode bool) {
+	defer os.Remove(path)
+
+	realName, err := snappy.InstallLocal(path, devmode, progress)
+
+	if realName != "" && realName != uploadName {
+		h.installStatus.Rename(uploadName, realName)
+	}
+
+	if err == nil {
+		h.markSideloaded(pickName(realName, uploadName))
+	}
+
+	progress.ErrorChan <- err
+	close(progress.ErrorChan)
+}
+
+// pickName returns realName if InstallLocal managed to report one,
+// falling back to uploadName when it did not.
+func pickName(realName, uploadName string) string {
+	if realName != "" {
+		return realName
+	}
+
+	return uploadName
+}
+
+func (h *Handler) sideloadPackage(uploadName, path string, devmode bool) error {
+	progress, err := h.installStatus.Add(uploadName)
+	if err != nil {
+		return err
+	}
+
+	go h.doSideloadPackage(progress, uploadName, path, devmode)
+
+	return nil
+}
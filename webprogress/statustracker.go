@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package webprogress
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StatusTracker keeps track of in-flight install/remove operations,
+// keyed by package name, so HTTP handlers can report progress without
+// holding a reference to the goroutine performing the operation.
+type StatusTracker struct {
+	mu       sync.Mutex
+	inFlight map[string]*WebProgress
+}
+
+// NewStatusTracker returns an empty StatusTracker.
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{inFlight: make(map[string]*WebProgress)}
+}
+
+// Add registers pkgName as installing and returns the WebProgress the
+// caller should hand to snappy.Install.
+func (t *StatusTracker) Add(pkgName string) (*WebProgress, error) {
+	return t.add(pkgName, StatusInstalling, StatusInstalled)
+}
+
+// AddRemove registers pkgName as removing and returns the WebProgress the
+// caller should hand to snappy.Remove.
+func (t *StatusTracker) AddRemove(pkgName string) (*WebProgress, error) {
+	return t.add(pkgName, StatusRemoving, StatusUninstalled)
+}
+
+func (t *StatusTracker) add(pkgName, inProgress, onSuccess string) (*WebProgress, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.inFlight[pkgName]; ok {
+		return nil, fmt.Errorf("an operation is already in progress for %q", pkgName)
+	}
+
+	wp := newWebProgress(pkgName, inProgress)
+	t.inFlight[pkgName] = wp
+
+	go t.await(wp, onSuccess)
+
+	return wp, nil
+}
+
+// await blocks until the operation reports its final error, then updates
+// wp to a terminal state and wakes up any SSE subscribers.
+func (t *StatusTracker) await(wp *WebProgress, onSuccess string) {
+	err := <-wp.ErrorChan
+
+	wp.mu.Lock()
+	wp.Error = err
+	wp.finished = true
+	if err == nil {
+		wp.Status = onSuccess
+	}
+	wp.mu.Unlock()
+
+	wp.broadcast()
+	wp.closeSubscribers()
+}
+
+// Get returns the WebProgress tracking pkgName, if any.
+func (t *StatusTracker) Get(pkgName string) (*WebProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wp, ok := t.inFlight[pkgName]
+
+	return wp, ok
+}
+
+// Rename moves the entry tracked under oldName to newName. It's for
+// callers that only learn an operation's real package name after
+// starting it (e.g. a sideloaded snap is first tracked under its
+// upload's filename, then renamed once snappy.InstallLocal reports the
+// name it actually installed).
+func (t *StatusTracker) Rename(oldName, newName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if oldName == newName {
+		return
+	}
+
+	wp, ok := t.inFlight[oldName]
+	if !ok {
+		return
+	}
+
+	delete(t.inFlight, oldName)
+	t.inFlight[newName] = wp
+}
+
+// Remove forgets about pkgName, typically once its terminal status has
+// been reported to the client.
+func (t *StatusTracker) Remove(pkgName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.inFlight, pkgName)
+}
+
+// Subscribe returns a channel of Frames for pkgName's in-flight
+// operation and a cancel function to stop receiving on it. ok is false
+// if no operation is in flight for pkgName.
+func (t *StatusTracker) Subscribe(pkgName string) (ch chan Frame, cancel func(), ok bool) {
+	wp, ok := t.Get(pkgName)
+	if !ok {
+		return nil, nil, false
+	}
+
+	ch = wp.subscribe()
+
+	return ch, func() { wp.unsubscribe(ch) }, true
+}
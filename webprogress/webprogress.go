@@ -0,0 +1,229 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package webprogress adapts snappy's progress.Meter interface to a
+// per-package tracker that the web handlers can poll or stream to the
+// browser.
+package webprogress
+
+import "sync"
+
+// Status values reported to the web UI for an installed, uninstalled or
+// in-flight package.
+const (
+	StatusInstalled   = "installed"
+	StatusUninstalled = "uninstalled"
+	StatusInstalling  = "installing"
+	StatusRemoving    = "removing"
+
+	// StatusRemoved marks a package whose binaries are gone but whose
+	// data and manifest are still retained on disk.
+	StatusRemoved = "removed"
+)
+
+// Frame is one incremental update of an in-flight operation, as sent on
+// the SSE stream.
+type Frame struct {
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"`
+	Message  string  `json:"message,omitempty"`
+	Done     bool    `json:"done"`
+}
+
+// WebProgress is a progress.Meter that records the state of a single
+// install or remove operation so it can be polled or streamed to the web
+// UI.
+type WebProgress struct {
+	// ErrorChan carries the final error (or nil) of the operation it is
+	// tracking. The caller must send exactly one value and then close
+	// it.
+	ErrorChan chan error
+
+	mu       sync.Mutex
+	pkgName  string
+	Status   string
+	Error    error
+	message  string
+	current  float64
+	total    float64
+	finished bool
+	subs     []chan Frame
+}
+
+func newWebProgress(pkgName, status string) *WebProgress {
+	return &WebProgress{
+		ErrorChan: make(chan error, 1),
+		pkgName:   pkgName,
+		Status:    status,
+	}
+}
+
+// Progress returns the operation's completion fraction in [0, 1].
+func (w *WebProgress) Progress() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.total == 0 {
+		return 0
+	}
+
+	return w.current / w.total
+}
+
+// Done reports whether the tracked operation has finished, successfully
+// or not.
+func (w *WebProgress) Done() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.finished
+}
+
+// Snapshot returns the operation's current status and, once it has
+// finished, its final error (nil otherwise). Unlike reading Status and
+// Error directly, it's safe to call while the operation is still
+// in-flight.
+func (w *WebProgress) Snapshot() (status string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.Status, w.Error
+}
+
+// Start implements progress.Meter.
+func (w *WebProgress) Start(pkg string, total float64) {
+	w.mu.Lock()
+	w.total = total
+	w.mu.Unlock()
+
+	w.broadcast()
+}
+
+// Set implements progress.Meter.
+func (w *WebProgress) Set(current float64) {
+	w.mu.Lock()
+	w.current = current
+	w.mu.Unlock()
+
+	w.broadcast()
+}
+
+// Spin implements progress.Meter.
+func (w *WebProgress) Spin(msg string) {
+	w.mu.Lock()
+	w.message = msg
+	w.mu.Unlock()
+
+	w.broadcast()
+}
+
+// Notify implements progress.Meter.
+func (w *WebProgress) Notify(msg string) {
+	w.Spin(msg)
+}
+
+// Finished implements progress.Meter.
+func (w *WebProgress) Finished() {
+	w.broadcast()
+}
+
+// Agreed implements progress.Meter; webdm never prompts interactively.
+func (w *WebProgress) Agreed(intro, license string) bool {
+	return true
+}
+
+// subscribe registers a channel that receives a Frame on every update,
+// until the operation is done, at which point the channel is closed. A
+// subscriber that falls behind misses frames rather than blocking the
+// operation; one that subscribes after the operation is done receives
+// only its final frame.
+func (w *WebProgress) subscribe() chan Frame {
+	ch := make(chan Frame, 8)
+
+	w.mu.Lock()
+	if w.finished {
+		w.mu.Unlock()
+		ch <- w.frame()
+		close(ch)
+		return ch
+	}
+	w.subs = append(w.subs, ch)
+	w.mu.Unlock()
+
+	return ch
+}
+
+func (w *WebProgress) unsubscribe(ch chan Frame) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, sub := range w.subs {
+		if sub == ch {
+			w.subs = append(w.subs[:i], w.subs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (w *WebProgress) frame() Frame {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	f := Frame{
+		Status:  w.Status,
+		Message: w.message,
+		Done:    w.finished,
+	}
+
+	if w.total != 0 {
+		f.Progress = w.current / w.total
+	}
+
+	if w.Error != nil {
+		f.Message = w.Error.Error()
+	}
+
+	return f
+}
+
+func (w *WebProgress) broadcast() {
+	f := w.frame()
+
+	w.mu.Lock()
+	subs := append([]chan Frame(nil), w.subs...)
+	w.mu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- f:
+		default:
+			// Slow subscriber: drop the frame rather than block the
+			// install/remove goroutine.
+		}
+	}
+}
+
+func (w *WebProgress) closeSubscribers() {
+	w.mu.Lock()
+	subs := w.subs
+	w.subs = nil
+	w.mu.Unlock()
+
+	for _, ch := range subs {
+		close(ch)
+	}
+}